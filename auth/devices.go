@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// DeviceStore mantém, por dispositivo, o segredo compartilhado usado no
+// esquema de assinatura HMAC (alternativa ao token JWT).
+type DeviceStore struct {
+	secrets map[string]string
+}
+
+// LoadDevices lê um arquivo JSON no formato {"device_id": "segredo", ...}
+// apontado por DEVICES_FILE. Um path vazio resulta em um DeviceStore
+// vazio (apenas autenticação via JWT fica disponível).
+func LoadDevices(path string) (*DeviceStore, error) {
+	if path == "" {
+		return &DeviceStore{secrets: map[string]string{}}, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: lendo DEVICES_FILE: %w", err)
+	}
+
+	secrets := map[string]string{}
+	if err := json.Unmarshal(raw, &secrets); err != nil {
+		return nil, fmt.Errorf("auth: parseando DEVICES_FILE: %w", err)
+	}
+
+	return &DeviceStore{secrets: secrets}, nil
+}
+
+// Secret retorna o segredo HMAC cadastrado para o dispositivo, se houver.
+func (d *DeviceStore) Secret(deviceID string) (string, bool) {
+	secret, ok := d.secrets[deviceID]
+	return secret, ok
+}
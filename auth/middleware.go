@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrMissingCredentials é retornado quando a requisição não traz nem
+// Authorization: Bearer nem X-Device-Signature.
+var ErrMissingCredentials = errors.New("auth: credenciais ausentes")
+
+// ErrInvalidSignature é retornado quando a assinatura HMAC não confere.
+var ErrInvalidSignature = errors.New("auth: assinatura inválida")
+
+// ErrUnknownDevice é retornado quando o X-Device-ID não está cadastrado.
+var ErrUnknownDevice = errors.New("auth: dispositivo desconhecido")
+
+// Authenticator resolve o device_id de uma requisição, aceitando um
+// token JWT (Authorization: Bearer ...) ou uma assinatura HMAC do corpo
+// (X-Device-ID + X-Device-Signature).
+type Authenticator struct {
+	manager *Manager
+	devices *DeviceStore
+}
+
+// NewAuthenticator combina o emissor/validador de JWT com o cadastro de
+// segredos HMAC por dispositivo.
+func NewAuthenticator(manager *Manager, devices *DeviceStore) *Authenticator {
+	return &Authenticator{manager: manager, devices: devices}
+}
+
+// Authenticate identifica o dispositivo que fez a requisição. body deve
+// ser o corpo já lido (necessário para validar a assinatura HMAC).
+func (a *Authenticator) Authenticate(r *http.Request, body []byte) (string, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		tokenString := strings.TrimPrefix(header, "Bearer ")
+		if tokenString == header {
+			return "", ErrMissingCredentials
+		}
+		return a.manager.ValidateToken(tokenString)
+	}
+
+	signature := r.Header.Get("X-Device-Signature")
+	deviceID := r.Header.Get("X-Device-ID")
+	if signature == "" || deviceID == "" {
+		return "", ErrMissingCredentials
+	}
+
+	secret, ok := a.devices.Secret(deviceID)
+	if !ok {
+		return "", ErrUnknownDevice
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	given, err := hex.DecodeString(signature)
+	if err != nil || subtle.ConstantTimeCompare(expected, given) != 1 {
+		return "", ErrInvalidSignature
+	}
+
+	return deviceID, nil
+}
+
+// RateLimitedLogger suprime logs repetidos da mesma chave (ex.: IP) dentro
+// de um intervalo, para que tentativas de acesso não autenticadas em loop
+// não inundem os logs do servidor.
+type RateLimitedLogger struct {
+	mu       sync.Mutex
+	interval time.Duration
+	lastSeen map[string]time.Time
+}
+
+// NewRateLimitedLogger cria um limitador que permite um log por chave a
+// cada interval.
+func NewRateLimitedLogger(interval time.Duration) *RateLimitedLogger {
+	return &RateLimitedLogger{interval: interval, lastSeen: map[string]time.Time{}}
+}
+
+// Allow retorna true na primeira vez que vê a chave e, depois, no máximo
+// uma vez a cada interval.
+func (l *RateLimitedLogger) Allow(key string) bool {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if last, ok := l.lastSeen[key]; ok && now.Sub(last) < l.interval {
+		return false
+	}
+	l.lastSeen[key] = now
+	return true
+}
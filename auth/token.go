@@ -0,0 +1,74 @@
+// Package auth emite e valida a identidade dos dispositivos (estufas)
+// que podem falar com o servidor: tokens JWT assinados com HS256 para o
+// caso comum, e assinatura HMAC do corpo da requisição como alternativa
+// para dispositivos que preferem não carregar um token de longa duração.
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken é retornado quando o token não pode ser validado
+// (assinatura incorreta, expirado, malformado, etc).
+var ErrInvalidToken = errors.New("auth: token inválido ou expirado")
+
+// DefaultTokenTTL é usado quando nenhuma validade é informada na emissão.
+const DefaultTokenTTL = 365 * 24 * time.Hour
+
+// Manager emite e valida tokens JWT por dispositivo, assinados com um
+// segredo compartilhado (JWT_SECRET).
+type Manager struct {
+	secret []byte
+}
+
+// NewManager cria um Manager a partir do segredo usado para assinar os
+// tokens. O segredo nunca deve ser vazio em produção.
+func NewManager(secret []byte) *Manager {
+	return &Manager{secret: secret}
+}
+
+// deviceClaims são as claims registradas em cada token, identificando o
+// dispositivo pelo campo padrão "sub".
+type deviceClaims struct {
+	jwt.RegisteredClaims
+}
+
+// IssueToken gera um token JWT HS256 para o device informado, válido por
+// ttl (DefaultTokenTTL se ttl <= 0).
+func (m *Manager) IssueToken(deviceID string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+
+	now := time.Now().UTC()
+	claims := deviceClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   deviceID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(m.secret)
+}
+
+// ValidateToken verifica a assinatura e validade do token e retorna o
+// device_id (claim "sub") associado.
+func (m *Manager) ValidateToken(tokenString string) (string, error) {
+	var claims deviceClaims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
+		return m.secret, nil
+	})
+	if err != nil || !token.Valid {
+		return "", ErrInvalidToken
+	}
+	if claims.Subject == "" {
+		return "", ErrInvalidToken
+	}
+
+	return claims.Subject, nil
+}
@@ -0,0 +1,244 @@
+// Package commands implementa a fila de comandos que os dashboards
+// enviam (via WebSocket) para atuar sobre a estufa (bomba/luz) e que o
+// ESP32 consome por polling em /api/device/commands.
+package commands
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Alvos e ações suportados pelo firmware da estufa.
+const (
+	AlvoBomba = "bomba"
+	AlvoLuz   = "luz"
+
+	AcaoLigar     = "ligar"
+	AcaoDesligar  = "desligar"
+	defaultTTL    = 30 // segundos
+	maxTTL        = 300
+	statusPending = "pending"
+	statusAcked   = "acked"
+
+	// maxPendingPerDevice limita quantos comandos um único dispositivo pode
+	// ter pendentes ao mesmo tempo, para que uma conexão WebSocket já
+	// autenticada não consiga inflar a fila indefinidamente enviando frames
+	// de comando mais rápido do que o ESP32 consegue confirmar.
+	maxPendingPerDevice = 20
+
+	// purgeInterval é o intervalo entre varreduras em segundo plano que
+	// removem comandos expirados, espelhando FileStore.retentionLoop, para
+	// que comandos nunca confirmados não fiquem ocupando a fila até que
+	// algum dispositivo chame Pending.
+	purgeInterval = 30 * time.Second
+)
+
+var (
+	// ErrAlvoInvalido indica um "alvo" fora do schema aceito.
+	ErrAlvoInvalido = errors.New("commands: alvo inválido")
+	// ErrAcaoInvalida indica uma "acao" fora do schema aceito.
+	ErrAcaoInvalida = errors.New("commands: acao inválida")
+	// ErrTTLInvalido indica um TTL fora da faixa permitida.
+	ErrTTLInvalido = errors.New("commands: ttl inválido")
+	// ErrComandoNaoEncontrado é retornado por Ack quando o id é desconhecido.
+	ErrComandoNaoEncontrado = errors.New("commands: comando não encontrado")
+	// ErrFilaCheia é retornado por Enqueue quando o dispositivo já tem
+	// maxPendingPerDevice comandos pendentes.
+	ErrFilaCheia = errors.New("commands: fila de comandos cheia para este dispositivo")
+)
+
+// Request é o payload bruto recebido do dashboard (frame "tipo":"comando").
+// O dispositivo alvo não vem do payload: é o device_id autenticado da
+// própria conexão WebSocket que enviou o frame (ver handleInboundMessage).
+type Request struct {
+	Tipo string `json:"tipo"`
+	Alvo string `json:"alvo"`
+	Acao string `json:"acao"`
+	TTL  int    `json:"ttl"`
+}
+
+// Command é um comando validado, com identidade e prazo de validade,
+// destinado a um único dispositivo (para que estufas diferentes, servidas
+// pelo mesmo servidor, não enxerguem nem confirmem comandos umas das
+// outras).
+type Command struct {
+	ID        string    `json:"id"`
+	DeviceID  string    `json:"device_id"`
+	Alvo      string    `json:"alvo"`
+	Acao      string    `json:"acao"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Status    string    `json:"status"`
+}
+
+// Expired indica se o comando já passou do seu TTL sem ser confirmado.
+func (c Command) Expired(now time.Time) bool {
+	return now.After(c.ExpiresAt)
+}
+
+// Queue mantém os comandos pendentes de entrega/confirmação em memória,
+// com uma rotina em segundo plano que remove comandos expirados mesmo
+// que nenhum dispositivo chame Pending.
+type Queue struct {
+	mu      sync.Mutex
+	pending map[string]*Command
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewQueue cria uma fila de comandos vazia e inicia a rotina de limpeza
+// em segundo plano.
+func NewQueue() *Queue {
+	q := &Queue{
+		pending: make(map[string]*Command),
+		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+
+	go q.purgeLoop()
+
+	return q
+}
+
+// Close encerra a rotina de limpeza em segundo plano.
+func (q *Queue) Close() {
+	close(q.stopCh)
+	<-q.doneCh
+}
+
+func (q *Queue) purgeLoop() {
+	defer close(q.doneCh)
+
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.stopCh:
+			return
+		case <-ticker.C:
+			q.purgeExpired()
+		}
+	}
+}
+
+// purgeExpired remove, de todos os dispositivos, os comandos cujo TTL já
+// passou sem confirmação.
+func (q *Queue) purgeExpired() {
+	now := time.Now().UTC()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for id, cmd := range q.pending {
+		if cmd.Expired(now) {
+			delete(q.pending, id)
+		}
+	}
+}
+
+// Enqueue valida o request recebido do dashboard e, se válido, adiciona
+// um novo comando à fila de pendentes do dispositivo deviceID.
+func (q *Queue) Enqueue(deviceID string, req Request) (Command, error) {
+	if req.Alvo != AlvoBomba && req.Alvo != AlvoLuz {
+		return Command{}, ErrAlvoInvalido
+	}
+	if req.Acao != AcaoLigar && req.Acao != AcaoDesligar {
+		return Command{}, ErrAcaoInvalida
+	}
+
+	ttl := req.TTL
+	if ttl == 0 {
+		ttl = defaultTTL
+	}
+	if ttl < 0 || ttl > maxTTL {
+		return Command{}, ErrTTLInvalido
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Command{}, err
+	}
+
+	now := time.Now().UTC()
+	cmd := Command{
+		ID:        id,
+		DeviceID:  deviceID,
+		Alvo:      req.Alvo,
+		Acao:      req.Acao,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(ttl) * time.Second),
+		Status:    statusPending,
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pendingForDevice := 0
+	for _, existing := range q.pending {
+		if existing.DeviceID == deviceID && !existing.Expired(now) {
+			pendingForDevice++
+		}
+	}
+	if pendingForDevice >= maxPendingPerDevice {
+		return Command{}, ErrFilaCheia
+	}
+
+	q.pending[cmd.ID] = &cmd
+
+	return cmd, nil
+}
+
+// Pending retorna os comandos do dispositivo deviceID ainda não
+// confirmados e não expirados, descartando (e removendo da fila, de
+// qualquer dispositivo) os que já passaram do TTL.
+func (q *Queue) Pending(deviceID string) []Command {
+	now := time.Now().UTC()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var result []Command
+	for id, cmd := range q.pending {
+		if cmd.Expired(now) {
+			delete(q.pending, id)
+			continue
+		}
+		if cmd.DeviceID == deviceID {
+			result = append(result, *cmd)
+		}
+	}
+
+	return result
+}
+
+// Ack marca como executado o comando id pertencente a deviceID e o remove
+// da fila de pendentes. Um comando de outro dispositivo é tratado como
+// inexistente, para que um dispositivo nunca confirme (ou descubra a
+// existência de) comandos que não são seus.
+func (q *Queue) Ack(deviceID, id string) (Command, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cmd, ok := q.pending[id]
+	if !ok || cmd.DeviceID != deviceID {
+		return Command{}, ErrComandoNaoEncontrado
+	}
+
+	cmd.Status = statusAcked
+	delete(q.pending, id)
+
+	return *cmd, nil
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,221 @@
+// Package hub mantém o conjunto de dashboards conectados via WebSocket e
+// distribui mensagens para eles sem que um cliente lento bloqueie os
+// demais: cada cliente tem seu próprio canal com buffer e goroutine de
+// escrita; se o buffer encher, o cliente é considerado lento e
+// desconectado. Cada cliente é associado a um device_id e só recebe
+// mensagens publicadas para esse dispositivo, para que dashboards de
+// estufas diferentes não vejam leituras nem comandos umas das outras.
+package hub
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultSendBuffer é o tamanho do canal de saída de cada cliente quando
+// nenhum valor é informado a NewBroadcaster.
+const DefaultSendBuffer = 32
+
+// DefaultPingInterval é o intervalo entre pings de keepalive quando
+// nenhum valor é informado a NewBroadcaster.
+const DefaultPingInterval = 30 * time.Second
+
+// pongWaitFactor define quanto tempo, em múltiplos de pingInterval, o
+// servidor espera por um pong antes de considerar a conexão morta.
+const pongWaitFactor = 2
+
+// Client representa um dashboard conectado, com seu canal de saída
+// dedicado e o device_id ao qual está associado.
+type Client struct {
+	conn     *websocket.Conn
+	send     chan []byte
+	deviceID string
+
+	b *Broadcaster
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// Broadcaster distribui mensagens para os clientes registrados.
+type Broadcaster struct {
+	sendBuffer   int
+	pingInterval time.Duration
+
+	mu      sync.Mutex
+	clients map[*Client]struct{}
+
+	messagesSent   uint64
+	clientsDropped uint64
+}
+
+// NewBroadcaster cria um Broadcaster. sendBuffer <= 0 usa
+// DefaultSendBuffer; pingInterval <= 0 usa DefaultPingInterval.
+func NewBroadcaster(sendBuffer int, pingInterval time.Duration) *Broadcaster {
+	if sendBuffer <= 0 {
+		sendBuffer = DefaultSendBuffer
+	}
+	if pingInterval <= 0 {
+		pingInterval = DefaultPingInterval
+	}
+
+	return &Broadcaster{
+		sendBuffer:   sendBuffer,
+		pingInterval: pingInterval,
+		clients:      make(map[*Client]struct{}),
+	}
+}
+
+// Add registra uma conexão já estabelecida (upgrade já feito pelo
+// chamador) e inicia sua goroutine de escrita com ping/pong keepalive.
+// deviceID é o dispositivo autenticado dessa conexão (ver
+// auth.Authenticator): o cliente só recebe mensagens publicadas via
+// PublishToDevice para esse mesmo deviceID. O chamador continua
+// responsável pelo loop de leitura (ReadMessage) da conexão, usado para
+// receber comandos dos dashboards.
+func (b *Broadcaster) Add(conn *websocket.Conn, deviceID string) *Client {
+	pongWait := b.pingInterval * pongWaitFactor
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	client := &Client{
+		conn:     conn,
+		send:     make(chan []byte, b.sendBuffer),
+		deviceID: deviceID,
+		b:        b,
+	}
+
+	b.mu.Lock()
+	b.clients[client] = struct{}{}
+	b.mu.Unlock()
+
+	go client.writePump()
+
+	return client
+}
+
+// Send entrega msg apenas a este cliente, de forma não bloqueante. É
+// usado para mensagens direcionadas (ex.: replay da última leitura para
+// quem acabou de conectar), sem afetar os demais clientes. Retorna false
+// se o buffer estiver cheio ou o cliente já tiver sido removido.
+//
+// c.mu também protege contra a corrida com Remove: sem ela, um envio
+// poderia cair num "select" entre a checagem e o close do canal feito
+// por uma remoção concorrente, e send<-msg num canal fechado gera panic.
+func (c *Client) Send(msg []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// Remove cancela o registro do cliente e encerra sua goroutine de
+// escrita. Idempotente: pode ser chamado mais de uma vez para o mesmo
+// cliente (ex.: pelo chamador e, simultaneamente, pela própria
+// goroutine de escrita ao detectar erro).
+func (b *Broadcaster) Remove(client *Client) {
+	b.mu.Lock()
+	_, existed := b.clients[client]
+	delete(b.clients, client)
+	b.mu.Unlock()
+
+	if !existed {
+		return
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if !client.closed {
+		client.closed = true
+		close(client.send)
+	}
+}
+
+// PublishToDevice envia msg apenas aos clientes registrados com o
+// device_id informado (dashboards de outras estufas nunca a recebem). O
+// envio a cada cliente é não bloqueante: se o buffer dele estiver cheio,
+// o cliente é considerado lento, contabilizado em clients_dropped e
+// desconectado, sem atrasar a entrega aos demais.
+func (b *Broadcaster) PublishToDevice(deviceID string, msg []byte) {
+	b.mu.Lock()
+	targets := make([]*Client, 0, len(b.clients))
+	for client := range b.clients {
+		if client.deviceID == deviceID {
+			targets = append(targets, client)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, client := range targets {
+		if client.Send(msg) {
+			atomic.AddUint64(&b.messagesSent, 1)
+		} else {
+			atomic.AddUint64(&b.clientsDropped, 1)
+			b.Remove(client)
+		}
+	}
+}
+
+// CurrentClients retorna o número de clientes registrados agora.
+func (b *Broadcaster) CurrentClients() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.clients)
+}
+
+// Metrics resume os contadores de observabilidade do Broadcaster.
+type Metrics struct {
+	MessagesSent   uint64
+	ClientsDropped uint64
+	CurrentClients int
+}
+
+// Metrics retorna uma foto dos contadores atuais.
+func (b *Broadcaster) Metrics() Metrics {
+	return Metrics{
+		MessagesSent:   atomic.LoadUint64(&b.messagesSent),
+		ClientsDropped: atomic.LoadUint64(&b.clientsDropped),
+		CurrentClients: b.CurrentClients(),
+	}
+}
+
+// writePump é a única goroutine que escreve na conexão: drena o canal
+// de saída do cliente e, periodicamente, envia um ping de keepalive.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(c.b.pingInterval)
+	defer ticker.Stop()
+	defer c.conn.Close()
+	defer c.b.Remove(c)
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, nil)
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestClient sobe um servidor WebSocket de teste, registra um único
+// Client no Broadcaster e devolve ambas as pontas da conexão. upgrader é
+// o único jeito de obter um *websocket.Conn de verdade para exercitar
+// Add/writePump.
+func newTestClient(t *testing.T, b *Broadcaster, deviceID string) (*Client, *websocket.Conn, func()) {
+	t.Helper()
+
+	var upgrader websocket.Upgrader
+	clientCh := make(chan *Client, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		clientCh <- b.Add(conn, deviceID)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		srv.Close()
+		t.Fatalf("dial: %v", err)
+	}
+
+	client := <-clientCh
+
+	return client, conn, func() {
+		conn.Close()
+		srv.Close()
+	}
+}
+
+// TestClientSendRacesWithRemove exercita diretamente a corrida corrigida
+// em 6a2f2b4: Send (via select/default no canal) disputando com Remove
+// (que fecha o canal) para o mesmo Client. Sem o campo closed guardado
+// por c.mu, o detector de corrida (ou um panic de "send on closed
+// channel") pega isso com -race.
+func TestClientSendRacesWithRemove(t *testing.T) {
+	b := NewBroadcaster(4, 50*time.Millisecond)
+	client, _, closeAll := newTestClient(t, b, "estufa-01")
+	defer closeAll()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.Send([]byte("msg"))
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.Remove(client)
+	}()
+
+	wg.Wait()
+}
+
+// TestPublishToDeviceFiltersByDevice garante que PublishToDevice só
+// entrega a clientes com o mesmo device_id, fechando a lacuna de
+// vazamento entre estufas corrigida em 917ef0c.
+func TestPublishToDeviceFiltersByDevice(t *testing.T) {
+	b := NewBroadcaster(4, 50*time.Millisecond)
+
+	clientA, connA, closeA := newTestClient(t, b, "estufa-01")
+	defer closeA()
+	clientB, connB, closeB := newTestClient(t, b, "estufa-02")
+	defer closeB()
+	defer b.Remove(clientA)
+	defer b.Remove(clientB)
+
+	b.PublishToDevice("estufa-01", []byte("só para estufa-01"))
+
+	connA.SetReadDeadline(time.Now().Add(time.Second))
+	if _, msg, err := connA.ReadMessage(); err != nil || string(msg) != "só para estufa-01" {
+		t.Fatalf("cliente de estufa-01 deveria receber a mensagem, err=%v msg=%q", err, msg)
+	}
+
+	connB.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := connB.ReadMessage(); err == nil {
+		t.Fatal("cliente de estufa-02 não deveria receber mensagem publicada para estufa-01")
+	}
+}
+
+// TestBroadcasterConcurrentPublishAndRemove dispara publicações e
+// desconexões concorrentes sobre vários clientes do mesmo dispositivo,
+// para cobrir com -race o caminho completo de PublishToDevice (fan-out)
+// correndo contra Remove disparado pela própria goroutine de escrita ao
+// detectar um WriteMessage com erro.
+func TestBroadcasterConcurrentPublishAndRemove(t *testing.T) {
+	b := NewBroadcaster(2, 20*time.Millisecond)
+
+	const clients = 8
+	conns := make([]*websocket.Conn, clients)
+	closers := make([]func(), clients)
+	for i := 0; i < clients; i++ {
+		_, conn, closeAll := newTestClient(t, b, "estufa-01")
+		conns[i] = conn
+		closers[i] = closeAll
+	}
+	defer func() {
+		for _, closeAll := range closers {
+			closeAll()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.PublishToDevice("estufa-01", []byte("msg"))
+		}()
+	}
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(c *websocket.Conn) {
+			defer wg.Done()
+			c.Close()
+		}(conn)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,62 @@
+// Package logger centraliza a configuração do zap usada pelo servidor,
+// trocando os antigos log.Printf com emojis por logs estruturados.
+package logger
+
+import (
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// New constrói o logger da aplicação a partir de LOG_LEVEL. Com
+// LOG_LEVEL=debug usa um encoder de console (legível por humanos); caso
+// contrário usa encoder JSON, no nível informado (info por padrão).
+func New() (*zap.Logger, error) {
+	raw := os.Getenv("LOG_LEVEL")
+
+	if raw == "debug" {
+		return NewDevelopment()
+	}
+
+	level := zapcore.InfoLevel
+	if raw != "" {
+		if err := level.UnmarshalText([]byte(raw)); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := zap.NewProductionConfig()
+	cfg.Level = zap.NewAtomicLevelAt(level)
+	cfg.EncoderConfig.TimeKey = "ts"
+	cfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	return cfg.Build()
+}
+
+// NewDevelopment constrói um logger com encoder de console, cores e
+// nível debug, pensado para rodar localmente.
+func NewDevelopment() (*zap.Logger, error) {
+	cfg := zap.NewDevelopmentConfig()
+	cfg.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	return cfg.Build()
+}
+
+// ForRequest deriva um logger filho carregando os campos comuns de uma
+// requisição/conexão (device, IP real, user-agent, id da conexão).
+func ForRequest(base *zap.Logger, remoteIP, userAgent, connID, deviceID string) *zap.Logger {
+	fields := make([]zap.Field, 0, 4)
+	if remoteIP != "" {
+		fields = append(fields, zap.String("remote_ip", remoteIP))
+	}
+	if userAgent != "" {
+		fields = append(fields, zap.String("ua", userAgent))
+	}
+	if connID != "" {
+		fields = append(fields, zap.String("conn_id", connID))
+	}
+	if deviceID != "" {
+		fields = append(fields, zap.String("device_id", deviceID))
+	}
+	return base.With(fields...)
+}
@@ -1,16 +1,29 @@
 package main
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"miniestufa-backend/auth"
+	"miniestufa-backend/commands"
+	"miniestufa-backend/hub"
+	"miniestufa-backend/logger"
+	"miniestufa-backend/model"
+	"miniestufa-backend/realip"
+	"miniestufa-backend/storage"
 )
 
 var upgrader = websocket.Upgrader{
@@ -21,14 +34,25 @@ var upgrader = websocket.Upgrader{
 
 // Variáveis globais para gerenciar clientes conectados
 var (
-	clients     = make(map[*websocket.Conn]bool)
-	clientsMu   sync.Mutex
-	lastReading *SensorData
+	broadcaster          *hub.Broadcaster
+	lastReading          *model.SensorData
+	readingsMu           sync.Mutex
+	lastReadingsByDevice = make(map[string]*model.SensorData)
+	dataStore            storage.Store
+	commandQ             = commands.NewQueue()
+	authenticator        *auth.Authenticator
+	authFailLogger       = auth.NewRateLimitedLogger(10 * time.Second)
+	trustedProxies       []*net.IPNet
+	log                  *zap.Logger
 )
 
 const (
 	maxRequestBodyBytes = 8 * 1024
 	maxLoggedBodyBytes  = 1024
+
+	defaultRetentionDays = 30
+	defaultHistoryLimit  = 500
+	maxHistoryLimit      = 5000
 )
 
 func sanitizeForLog(content []byte) string {
@@ -54,23 +78,81 @@ func formatIntWithUnit(value *int, unit string) string {
 	return fmt.Sprintf("%d%s", *value, unit)
 }
 
-type SensorData struct {
-	Tipo            string   `json:"tipo"`               // Ex.: "leituras"
-	DataHora        string   `json:"data_hora"`          // Formato: "DD/MM/YYYY HH:MM:SS"
-	Temperatura     *float64 `json:"temperatura"`        // Temperatura em °C (pode não ser enviada)
-	UmidadeAr       *float64 `json:"umidade_ar"`         // Umidade do ar em %
-	Luminosidade    *int     `json:"luminosidade"`       // Luminosidade 0-100
-	UmidadeSolo     *int     `json:"umidade_solo"`       // Umidade do solo calibrada em %
-	SoloBruto       *int     `json:"solo_bruto"`         // Valor bruto do sensor ADC
-	SoloBrutoLegacy *int     `json:"umidade_solo_bruto"` // Payload legado do bridge
-	StatusBomba     string   `json:"status_bomba"`       // "Bomba ativada" ou "Bomba desativada"
-	StatusLuz       string   `json:"status_luz"`         // "Luz ligada" ou "Luz desligada"
+// subtleTokensDiffer compara dois tokens em tempo constante, evitando que
+// o tempo de resposta vaze quantos caracteres do início já batem.
+func subtleTokensDiffer(given, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) != 1
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "issue-token" {
+		runIssueTokenCLI(os.Args[2:])
+		return
+	}
+
+	zapLogger, err := logger.New()
+	if err != nil {
+		panic(fmt.Sprintf("erro ao iniciar logger: %v", err))
+	}
+	log = zapLogger
+	defer log.Sync()
+
+	trustedProxies = realip.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		jwtSecret = "dev-only-insecure-secret"
+		log.Warn("JWT_SECRET não definido, usando segredo de desenvolvimento (NÃO use em produção)")
+	}
+
+	devices, err := auth.LoadDevices(os.Getenv("DEVICES_FILE"))
+	if err != nil {
+		log.Fatal("erro ao carregar DEVICES_FILE", zap.Error(err))
+	}
+	authenticator = auth.NewAuthenticator(auth.NewManager([]byte(jwtSecret)), devices)
+
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = "./data" // fallback para desenvolvimento local
+	}
+	retentionDays := defaultRetentionDays
+	if raw := os.Getenv("DATA_RETENTION_DAYS"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil {
+			retentionDays = parsed
+		}
+	}
+
+	store, err := storage.NewFileStore(dataDir, retentionDays)
+	if err != nil {
+		log.Fatal("erro ao iniciar armazenamento persistente", zap.Error(err))
+	}
+	dataStore = store
+	defer dataStore.Close()
+	defer commandQ.Close()
+
+	sendBuffer := hub.DefaultSendBuffer
+	if raw := os.Getenv("WS_SEND_BUFFER"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil {
+			sendBuffer = parsed
+		}
+	}
+	pingInterval := hub.DefaultPingInterval
+	if raw := os.Getenv("WS_PING_INTERVAL"); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil {
+			pingInterval = parsed
+		}
+	}
+	broadcaster = hub.NewBroadcaster(sendBuffer, pingInterval)
+
 	http.HandleFunc("/ws", handleConnections)
 	http.HandleFunc("/api/sensor/latest", handleLatestReading)
 	http.HandleFunc("/api/sensor/push", handleSensorPush)
+	http.HandleFunc("/api/sensor/history", handleSensorHistory)
+	http.HandleFunc("/api/sensor/stats", handleSensorStats)
+	http.HandleFunc("/api/device/commands", handleDeviceCommands)
+	http.HandleFunc("/api/device/ack", handleDeviceAck)
+	http.HandleFunc("/api/auth/rotate", handleAuthRotate)
+	http.HandleFunc("/metrics", handleMetrics)
 
 	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -83,82 +165,147 @@ func main() {
 		port = "8080" // fallback para desenvolvimento local
 	}
 
-	log.Println("🚀 Servidor WebSocket rodando em :" + port + "/ws")
-	log.Println("📊 API REST disponível em :" + port + "/api/sensor/latest")
-	log.Println("🌱 Endpoint para estufa em :" + port + "/api/sensor/push")
-	log.Println("💚 Health check em :" + port + "/health")
+	log.Info("servidor iniciado",
+		zap.String("ws", "/ws"),
+		zap.String("sensor_latest", "/api/sensor/latest"),
+		zap.String("sensor_push", "/api/sensor/push"),
+		zap.String("sensor_history", "/api/sensor/history"),
+		zap.String("health", "/health"),
+		zap.String("metrics", "/metrics"),
+		zap.String("port", port),
+		zap.String("data_dir", dataDir),
+	)
+
+	if err := http.ListenAndServe(":"+port, nil); err != nil {
+		log.Fatal("erro no servidor", zap.Error(err))
+	}
+}
+
+// runIssueTokenCLI implementa o subcomando `issue-token`, usado para
+// gerar o token que cada estufa deve enviar em Authorization: Bearer.
+//
+//	go run . issue-token -device=estufa-01 -ttl=8760h
+func runIssueTokenCLI(args []string) {
+	fs := flag.NewFlagSet("issue-token", flag.ExitOnError)
+	deviceID := fs.String("device", "", "identificador do dispositivo (obrigatório)")
+	ttl := fs.Duration("ttl", auth.DefaultTokenTTL, "validade do token (ex.: 8760h)")
+	fs.Parse(args)
+
+	if *deviceID == "" {
+		fmt.Fprintln(os.Stderr, "use -device=<id> para informar o dispositivo")
+		os.Exit(1)
+	}
 
-	err := http.ListenAndServe(":"+port, nil)
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		fmt.Fprintln(os.Stderr, "JWT_SECRET precisa estar definido para emitir tokens")
+		os.Exit(1)
+	}
+
+	manager := auth.NewManager([]byte(jwtSecret))
+	token, err := manager.IssueToken(*deviceID, *ttl)
 	if err != nil {
-		log.Fatal("❌ Erro no servidor:", err)
+		fmt.Fprintln(os.Stderr, "erro ao emitir token:", err)
+		os.Exit(1)
 	}
+
+	fmt.Println(token)
 }
 
 func handleConnections(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	remoteIP := realip.ClientIP(r, trustedProxies)
+	userAgent := r.Header.Get("User-Agent")
+	if userAgent == "" {
+		userAgent = "desconhecido"
+	}
+	connID := newConnID()
+
+	// Navegadores não conseguem definir Authorization no handshake do
+	// WebSocket, então também aceitamos o token JWT via query string.
+	if r.Header.Get("Authorization") == "" {
+		if tokenString := r.URL.Query().Get("token"); tokenString != "" {
+			r.Header.Set("Authorization", "Bearer "+tokenString)
+		}
+	}
+
+	deviceID, err := authenticator.Authenticate(r, nil)
 	if err != nil {
-		log.Println("❌ Erro ao atualizar conexão:", err)
+		if authFailLogger.Allow(remoteIP) {
+			log.Warn("conexão WebSocket não autenticada rejeitada", zap.String("remote_ip", remoteIP), zap.Error(err))
+		}
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
 		return
 	}
-	defer conn.Close()
 
-	remoteHost := r.RemoteAddr
-	if host, _, errSplit := net.SplitHostPort(remoteHost); errSplit == nil {
-		remoteHost = host
-	}
-	userAgent := r.Header.Get("User-Agent")
-	if userAgent == "" {
-		userAgent = "desconhecido"
+	reqLog := logger.ForRequest(log, remoteIP, userAgent, connID, deviceID)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		reqLog.Error("erro ao atualizar conexão para WebSocket", zap.Error(err))
+		return
 	}
 
-	// Registra o novo cliente
-	clientsMu.Lock()
-	clients[conn] = true
-	activeConnections := len(clients)
-	clientsMu.Unlock()
+	// Registra o novo cliente no hub: a partir daqui o envio de mensagens
+	// (incluindo ping/pong de keepalive) é responsabilidade da sua própria
+	// goroutine de escrita, então o loop abaixo só precisa ler.
+	client := broadcaster.Add(conn, deviceID)
+	defer broadcaster.Remove(client)
 
-	log.Printf("🔗 Sessão WebSocket estabelecida | origem=%s | ua=%s | conexões=%d", remoteHost, userAgent, activeConnections)
+	reqLog.Info("sessão WebSocket estabelecida", zap.Int("conexoes_ativas", broadcaster.CurrentClients()))
 
 	// Se existe última leitura, envia imediatamente
-	if lastReading != nil {
-		jsonData, _ := json.Marshal(lastReading)
-		conn.WriteMessage(websocket.TextMessage, jsonData)
-		log.Printf("↩️ Última leitura replicada para sessão recente | origem=%s", remoteHost)
+	readingsMu.Lock()
+	reading := lastReadingsByDevice[deviceID]
+	readingsMu.Unlock()
+	if reading != nil {
+		jsonData, _ := json.Marshal(reading)
+		client.Send(jsonData)
+		reqLog.Debug("última leitura replicada para sessão recente")
 	}
 
-	// Mantém conexão aberta e aguarda desconexão
+	// Mantém conexão aberta, processando comandos enviados pelos dashboards
 	for {
-		_, _, err := conn.ReadMessage()
+		_, payload, err := conn.ReadMessage()
 		if err != nil {
-			log.Printf("⚠️ Sessão WebSocket encerrada com erro | origem=%s | detalhe=%v", remoteHost, err)
+			reqLog.Info("sessão WebSocket encerrada", zap.Error(err))
 			break
 		}
+		handleInboundMessage(deviceID, payload, reqLog)
 	}
 
-	// Remove cliente quando desconectar
-	clientsMu.Lock()
-	delete(clients, conn)
-	activeConnections = len(clients)
-	clientsMu.Unlock()
+	reqLog.Info("sessão WebSocket finalizada", zap.Int("conexoes_ativas", broadcaster.CurrentClients()))
+}
 
-	log.Printf("📴 Sessão WebSocket finalizada | origem=%s | conexões_ativas=%d", remoteHost, activeConnections)
+// newConnID gera um identificador curto para correlacionar os logs de
+// uma mesma conexão WebSocket.
+func newConnID() string {
+	return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
 }
 
 func handleLatestReading(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	if lastReading == nil {
+	readingsMu.Lock()
+	reading := lastReading
+	if deviceID := r.URL.Query().Get("device"); deviceID != "" {
+		reading = lastReadingsByDevice[deviceID]
+	}
+	readingsMu.Unlock()
+
+	if reading == nil {
 		w.WriteHeader(http.StatusNoContent)
 		json.NewEncoder(w).Encode(map[string]string{"message": "Nenhuma leitura disponível ainda"})
 		return
 	}
 
-	json.NewEncoder(w).Encode(lastReading)
+	json.NewEncoder(w).Encode(reading)
 }
 
 // Endpoint que a ESTUFA vai chamar para enviar dados
 func handleSensorPush(w http.ResponseWriter, r *http.Request) {
+	remoteIP := realip.ClientIP(r, trustedProxies)
+
 	// Headers CORS (para aceitar de qualquer origem)
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
@@ -178,28 +325,42 @@ func handleSensorPush(w http.ResponseWriter, r *http.Request) {
 
 	bodyBytes, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodyBytes))
 	if err != nil {
-		log.Printf("❌ Erro ao ler body da requisição (%s): %v", r.RemoteAddr, err)
+		log.Error("erro ao ler body da requisição", zap.String("remote_ip", remoteIP), zap.Error(err))
 		http.Error(w, "Erro ao ler requisição", http.StatusBadRequest)
 		return
 	}
 
 	if len(bodyBytes) == 0 {
-		log.Printf("⚠️ Requisição vazia recebida da estufa (%s)", r.RemoteAddr)
+		log.Warn("requisição vazia recebida da estufa", zap.String("remote_ip", remoteIP))
 		http.Error(w, "Body vazio", http.StatusBadRequest)
 		return
 	}
 
-	var data SensorData
+	deviceID, err := authenticator.Authenticate(r, bodyBytes)
+	if err != nil {
+		if authFailLogger.Allow(remoteIP) {
+			log.Warn("requisição não autenticada rejeitada", zap.String("remote_ip", remoteIP), zap.Error(err))
+		}
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+
+	reqLog := logger.ForRequest(log, remoteIP, r.Header.Get("User-Agent"), "", deviceID)
+
+	var data model.SensorData
 	if err := json.Unmarshal(bodyBytes, &data); err != nil {
 		logBody := string(bodyBytes)
 		if len(logBody) > maxLoggedBodyBytes {
 			logBody = logBody[:maxLoggedBodyBytes] + "...(truncado)"
 		}
-		log.Printf("❌ JSON inválido recebido (%s): %v | Payload=%s", r.RemoteAddr, err, logBody)
+		reqLog.Error("JSON inválido recebido", zap.Error(err), zap.String("payload", logBody))
 		http.Error(w, "JSON inválido", http.StatusBadRequest)
 		return
 	}
 
+	// O device_id vem sempre do token/assinatura validados, nunca do payload
+	data.DeviceID = deviceID
+
 	// Normalização para payloads legados que usam outras chaves
 	if data.SoloBruto == nil && data.SoloBrutoLegacy != nil && *data.SoloBrutoLegacy > 0 {
 		data.SoloBruto = data.SoloBrutoLegacy
@@ -218,24 +379,32 @@ func handleSensorPush(w http.ResponseWriter, r *http.Request) {
 		data.StatusLuz = "dado não recebido"
 	}
 
-	log.Printf("📥 Payload recebido da estufa (%s): %s", r.RemoteAddr, sanitizeForLog(bodyBytes))
+	reqLog.Debug("payload recebido da estufa", zap.String("payload", sanitizeForLog(bodyBytes)))
 
-	// Armazena como última leitura
+	// Armazena como última leitura (global e por dispositivo)
+	readingsMu.Lock()
 	lastReading = &data
+	lastReadingsByDevice[deviceID] = &data
+	readingsMu.Unlock()
 
-	log.Printf("🌱 Recebido da estufa: Tipo=%s, Data=%s, Temp=%s, Umidade=%s, Luz=%s, Solo=%s (Bruto=%s), StatusBomba=%s, StatusLuz=%s",
-		data.Tipo,
-		data.DataHora,
-		formatFloatWithUnit(data.Temperatura, "°C"),
-		formatFloatWithUnit(data.UmidadeAr, "%"),
-		formatIntWithUnit(data.Luminosidade, "%"),
-		formatIntWithUnit(data.UmidadeSolo, "%"),
-		formatIntWithUnit(data.SoloBruto, ""),
-		data.StatusBomba,
-		data.StatusLuz)
+	if err := dataStore.Append(data); err != nil {
+		reqLog.Error("erro ao persistir leitura", zap.Error(err))
+	}
 
-	// Envia para todos os dashboards conectados via WebSocket
-	broadcastToClients(data)
+	reqLog.Info("leitura recebida da estufa",
+		zap.String("tipo", data.Tipo),
+		zap.String("data_hora", data.DataHora),
+		zap.String("temperatura", formatFloatWithUnit(data.Temperatura, "°C")),
+		zap.String("umidade_ar", formatFloatWithUnit(data.UmidadeAr, "%")),
+		zap.String("luminosidade", formatIntWithUnit(data.Luminosidade, "%")),
+		zap.String("umidade_solo", formatIntWithUnit(data.UmidadeSolo, "%")),
+		zap.String("solo_bruto", formatIntWithUnit(data.SoloBruto, "")),
+		zap.String("status_bomba", data.StatusBomba),
+		zap.String("status_luz", data.StatusLuz),
+	)
+
+	// Envia só para os dashboards conectados desta estufa via WebSocket
+	broadcastToClients(deviceID, data)
 
 	// Responde sucesso para a estufa
 	w.Header().Set("Content-Type", "application/json")
@@ -246,26 +415,316 @@ func handleSensorPush(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Função para enviar dados para todos os clientes WebSocket
-func broadcastToClients(data SensorData) {
+// Função para enviar dados para os clientes WebSocket da mesma estufa
+func broadcastToClients(deviceID string, data model.SensorData) {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
-		log.Println("❌ Erro ao serializar JSON:", err)
+		log.Error("erro ao serializar JSON para broadcast", zap.Error(err))
+		return
+	}
+	broadcastRaw(deviceID, jsonData)
+}
+
+// broadcastRaw envia um payload já serializado apenas aos dashboards
+// conectados a deviceID (usado tanto para leituras quanto para frames de
+// comando). O próprio hub.Broadcaster cuida de não deixar um cliente
+// lento atrasar os demais.
+func broadcastRaw(deviceID string, jsonData []byte) {
+	broadcaster.PublishToDevice(deviceID, jsonData)
+}
+
+// inboundEnvelope identifica o "tipo" de um frame recebido pelo WebSocket
+// antes de decidir como decodificar o restante do payload.
+type inboundEnvelope struct {
+	Tipo string `json:"tipo"`
+}
+
+// commandStatusMessage é o frame enviado de volta aos dashboards quando um
+// comando é aceito, recusado ou executado, para refletir o estado atual.
+type commandStatusMessage struct {
+	Tipo    string           `json:"tipo"`
+	Status  string           `json:"status"`
+	Erro    string           `json:"erro,omitempty"`
+	Comando commands.Command `json:"comando,omitempty"`
+}
+
+// handleInboundMessage decodifica um frame recebido de um dashboard pelo
+// WebSocket e, quando é um comando, valida e enfileira para o ESP32 buscar.
+// deviceID é o dispositivo autenticado da conexão WebSocket (ver
+// handleConnections) e se torna o alvo do comando.
+func handleInboundMessage(deviceID string, payload []byte, reqLog *zap.Logger) {
+	var envelope inboundEnvelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		reqLog.Warn("frame WebSocket ilegível", zap.Error(err))
+		return
+	}
+
+	if envelope.Tipo != "comando" {
+		// Frames que não são comandos (ex.: pings de aplicação) são ignorados.
+		return
+	}
+
+	var req commands.Request
+	if err := json.Unmarshal(payload, &req); err != nil {
+		reqLog.Warn("comando ilegível", zap.Error(err))
+		return
+	}
+
+	cmd, err := commandQ.Enqueue(deviceID, req)
+	if err != nil {
+		reqLog.Warn("comando rejeitado", zap.String("alvo", req.Alvo), zap.String("acao", req.Acao), zap.Error(err))
+		msg, _ := json.Marshal(commandStatusMessage{Tipo: "comando_status", Status: "rejeitado", Erro: err.Error()})
+		broadcastRaw(deviceID, msg)
+		return
+	}
+
+	reqLog.Info("comando enfileirado", zap.String("id", cmd.ID), zap.String("alvo", cmd.Alvo), zap.String("acao", cmd.Acao))
+	msg, _ := json.Marshal(commandStatusMessage{Tipo: "comando_status", Status: "enfileirado", Comando: cmd})
+	broadcastRaw(deviceID, msg)
+}
+
+// handleDeviceCommands é consultado pelo ESP32 para buscar comandos
+// pendentes ainda não confirmados.
+func handleDeviceCommands(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	remoteIP := realip.ClientIP(r, trustedProxies)
+	deviceID, err := authenticator.Authenticate(r, nil)
+	if err != nil {
+		if authFailLogger.Allow(remoteIP) {
+			log.Warn("requisição não autenticada rejeitada", zap.String("remote_ip", remoteIP), zap.Error(err))
+		}
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"comandos": commandQ.Pending(deviceID),
+	})
+}
+
+// handleDeviceAck é chamado pelo ESP32 para confirmar que um comando foi
+// executado, removendo-o da fila de pendentes e notificando os dashboards.
+func handleDeviceAck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	remoteIP := realip.ClientIP(r, trustedProxies)
+	bodyBytes, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodyBytes))
+	if err != nil {
+		http.Error(w, "Erro ao ler requisição", http.StatusBadRequest)
+		return
+	}
+
+	deviceID, err := authenticator.Authenticate(r, bodyBytes)
+	if err != nil {
+		if authFailLogger.Allow(remoteIP) {
+			log.Warn("requisição não autenticada rejeitada", zap.String("remote_ip", remoteIP), zap.Error(err))
+		}
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+
+	var ackReq struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(bodyBytes, &ackReq); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+
+	cmd, err := commandQ.Ack(deviceID, ackReq.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	log.Info("comando confirmado pela estufa", zap.String("id", cmd.ID), zap.String("alvo", cmd.Alvo), zap.String("acao", cmd.Acao))
+
+	msg, _ := json.Marshal(commandStatusMessage{Tipo: "comando_status", Status: "executado", Comando: cmd})
+	broadcastRaw(deviceID, msg)
+
+	json.NewEncoder(w).Encode(map[string]string{"status": "ack"})
+}
+
+// handleSensorHistory retorna leituras persistidas em um intervalo de
+// tempo, com suporte a paginação (limit), projeção de campos (fields) e
+// filtro por dispositivo (device); sem device, mistura leituras de todas
+// as estufas.
+func handleSensorHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	query := r.URL.Query()
+
+	to := time.Now().UTC()
+	if raw := query.Get("to"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, "Parâmetro 'to' inválido, use RFC3339", http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+
+	from := to.Add(-24 * time.Hour)
+	if raw := query.Get("from"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, "Parâmetro 'from' inválido, use RFC3339", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+
+	limit := defaultHistoryLimit
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Parâmetro 'limit' inválido", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	var fields []string
+	if raw := query.Get("fields"); raw != "" {
+		fields = strings.Split(raw, ",")
+	}
+
+	records, err := dataStore.Query(from, to, fields, limit, query.Get("device"))
+	if err != nil {
+		log.Error("erro ao consultar histórico", zap.Error(err))
+		http.Error(w, "Erro ao consultar histórico", http.StatusInternalServerError)
 		return
 	}
 
-	clientsMu.Lock()
-	defer clientsMu.Unlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":  from,
+		"to":    to,
+		"count": len(records),
+		"data":  records,
+	})
+}
 
-	for client := range clients {
-		if err := client.WriteMessage(websocket.TextMessage, jsonData); err != nil {
-			log.Println("⚠️ Erro ao enviar para cliente, removendo:", err)
-			client.Close()
-			delete(clients, client)
+// handleSensorStats retorna min/max/avg por campo numérico dentro de uma
+// janela relativa ao momento atual (ex.: window=1h, window=24h), com
+// filtro opcional por dispositivo (device).
+func handleSensorStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	window := time.Hour
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Parâmetro 'window' inválido, use algo como '1h' ou '30m'", http.StatusBadRequest)
+			return
 		}
+		window = parsed
+	}
+
+	var fields []string
+	if raw := r.URL.Query().Get("fields"); raw != "" {
+		fields = strings.Split(raw, ",")
 	}
 
-	if len(clients) > 0 {
-		log.Printf("📡 Broadcast enviado para %d cliente(s)", len(clients))
+	stats, err := dataStore.Stats(window, fields, r.URL.Query().Get("device"))
+	if err != nil {
+		log.Error("erro ao calcular estatísticas", zap.Error(err))
+		http.Error(w, "Erro ao calcular estatísticas", http.StatusInternalServerError)
+		return
 	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"window": window.String(),
+		"stats":  stats,
+	})
+}
+
+// handleMetrics expõe, em formato de exposição do Prometheus, os
+// contadores do hub de WebSocket: mensagens enviadas, clientes
+// descartados por excesso de buffer e clientes conectados agora.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	m := broadcaster.Metrics()
+
+	fmt.Fprintf(w, "# TYPE messages_sent counter\nmessages_sent %d\n", m.MessagesSent)
+	fmt.Fprintf(w, "# TYPE clients_dropped counter\nclients_dropped %d\n", m.ClientsDropped)
+	fmt.Fprintf(w, "# TYPE current_clients gauge\ncurrent_clients %d\n", m.CurrentClients)
+}
+
+// handleAuthRotate é um endpoint administrativo protegido por ADMIN_TOKEN
+// que emite um novo token para um device_id, para rotação de credenciais
+// comprometidas ou renovação de validade. O token anterior não é
+// revogado: continua válido até a sua própria expiração.
+func handleAuthRotate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	remoteIP := realip.ClientIP(r, trustedProxies)
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if adminToken == "" || subtleTokensDiffer(given, adminToken) {
+		if authFailLogger.Allow(remoteIP) {
+			log.Warn("tentativa de rotação de token sem autorização de admin", zap.String("remote_ip", remoteIP))
+		}
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		DeviceID string `json:"device_id"`
+		TTL      string `json:"ttl"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBodyBytes)).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	if req.DeviceID == "" {
+		http.Error(w, "device_id é obrigatório", http.StatusBadRequest)
+		return
+	}
+
+	ttl := auth.DefaultTokenTTL
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			http.Error(w, "ttl inválido", http.StatusBadRequest)
+			return
+		}
+		ttl = parsed
+	}
+
+	jwtSecret := os.Getenv("JWT_SECRET")
+	token, err := auth.NewManager([]byte(jwtSecret)).IssueToken(req.DeviceID, ttl)
+	if err != nil {
+		log.Error("erro ao emitir token", zap.String("device_id", req.DeviceID), zap.Error(err))
+		http.Error(w, "Erro ao emitir token", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info("token rotacionado para dispositivo", zap.String("device_id", req.DeviceID))
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"device_id": req.DeviceID,
+		"token":     token,
+	})
 }
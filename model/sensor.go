@@ -0,0 +1,19 @@
+// Package model define as estruturas de dados compartilhadas entre o
+// servidor HTTP/WebSocket e os subsistemas de persistência, autenticação
+// e comandos.
+package model
+
+// SensorData representa uma leitura enviada pela estufa (ESP32).
+type SensorData struct {
+	DeviceID        string   `json:"device_id,omitempty"` // Preenchido pelo servidor a partir do token ou da assinatura HMAC validados
+	Tipo            string   `json:"tipo"`                // Ex.: "leituras"
+	DataHora        string   `json:"data_hora"`           // Formato: "DD/MM/YYYY HH:MM:SS"
+	Temperatura     *float64 `json:"temperatura"`         // Temperatura em °C (pode não ser enviada)
+	UmidadeAr       *float64 `json:"umidade_ar"`          // Umidade do ar em %
+	Luminosidade    *int     `json:"luminosidade"`        // Luminosidade 0-100
+	UmidadeSolo     *int     `json:"umidade_solo"`        // Umidade do solo calibrada em %
+	SoloBruto       *int     `json:"solo_bruto"`          // Valor bruto do sensor ADC
+	SoloBrutoLegacy *int     `json:"umidade_solo_bruto"`  // Payload legado do bridge
+	StatusBomba     string   `json:"status_bomba"`        // "Bomba ativada" ou "Bomba desativada"
+	StatusLuz       string   `json:"status_luz"`          // "Luz ligada" ou "Luz desligada"
+}
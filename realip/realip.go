@@ -0,0 +1,82 @@
+// Package realip resolve o IP real de um cliente quando o servidor roda
+// atrás de um proxy reverso (Render, Heroku, Nginx), que sobrescreve
+// r.RemoteAddr com o endereço do próprio proxy.
+package realip
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseTrustedProxies converte uma lista de CIDRs separados por vírgula
+// (ex.: TRUSTED_PROXIES="10.0.0.0/8,172.16.0.0/12") em *net.IPNet. CIDRs
+// inválidos são ignorados silenciosamente.
+func ParseTrustedProxies(raw string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipNet)
+		}
+	}
+	return nets
+}
+
+// ClientIP retorna o IP real do cliente. Os cabeçalhos X-Real-IP e
+// X-Forwarded-For só são considerados quando a conexão TCP direta (
+// r.RemoteAddr) vem de um proxy confiável; caso contrário, um cliente
+// malicioso poderia forjar esses cabeçalhos. Quando confiável, usa
+// X-Real-IP; na ausência dele, percorre X-Forwarded-For da direita para
+// a esquerda e retorna a primeira entrada que não seja, ela própria, um
+// proxy confiável.
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	remoteIP := hostOnly(r.RemoteAddr)
+
+	if !isTrusted(remoteIP, trusted) {
+		return remoteIP
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		return realIP
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		parts := strings.Split(xff, ",")
+		for i := len(parts) - 1; i >= 0; i-- {
+			candidate := strings.TrimSpace(parts[i])
+			if candidate == "" {
+				continue
+			}
+			if !isTrusted(candidate, trusted) {
+				return candidate
+			}
+		}
+	}
+
+	return remoteIP
+}
+
+func hostOnly(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+func isTrusted(rawIP string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(rawIP)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,406 @@
+// Package storage persiste as leituras recebidas da estufa em arquivos
+// JSON-lines agrupados por dia, permitindo consultas históricas mesmo
+// após um restart do servidor. A interface Store é pensada para que um
+// backend baseado em SQLite ou Postgres possa substituir o FileStore no
+// futuro sem tocar nos handlers HTTP.
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"miniestufa-backend/model"
+)
+
+// Record é uma leitura com o instante em que foi recebida pelo servidor.
+type Record struct {
+	Timestamp time.Time        `json:"timestamp"`
+	Data      model.SensorData `json:"data"`
+}
+
+// FieldStats resume um campo numérico dentro de uma janela de tempo.
+type FieldStats struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Avg   float64 `json:"avg"`
+	Count int     `json:"count"`
+}
+
+// Store é o contrato usado pelos handlers para gravar e consultar
+// leituras, independente do backend concreto. deviceID vazio em Query e
+// Stats significa "todos os dispositivos"; caso contrário, só leituras
+// daquele device_id são consideradas.
+type Store interface {
+	Append(reading model.SensorData) error
+	Query(from, to time.Time, fields []string, limit int, deviceID string) ([]Record, error)
+	Stats(window time.Duration, fields []string, deviceID string) (map[string]FieldStats, error)
+	Close() error
+}
+
+const dayFileLayout = "2006-01-02"
+
+// FileStore grava cada leitura como uma linha JSON em um arquivo
+// "readings-YYYY-MM-DD.jsonl" dentro de dataDir, com retenção e
+// compactação rodando em background.
+type FileStore struct {
+	dataDir       string
+	retentionDays int
+
+	mu sync.RWMutex
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewFileStore cria (se necessário) o diretório de dados e inicia a
+// rotina de retenção em background. retentionDays <= 0 desativa a
+// limpeza automática.
+func NewFileStore(dataDir string, retentionDays int) (*FileStore, error) {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, fmt.Errorf("storage: criando data dir: %w", err)
+	}
+
+	fs := &FileStore{
+		dataDir:       dataDir,
+		retentionDays: retentionDays,
+		stopCh:        make(chan struct{}),
+		doneCh:        make(chan struct{}),
+	}
+
+	go fs.retentionLoop()
+
+	return fs, nil
+}
+
+// Append grava a leitura no arquivo do dia corrente. A gravação é feita
+// em modo append, então cada linha já é atômica ao nível do sistema de
+// arquivos; não há necessidade de write-temp+rename aqui (isso é usado
+// na compactação, ver compactFile).
+func (fs *FileStore) Append(reading model.SensorData) error {
+	now := time.Now().UTC()
+
+	record := Record{Timestamp: now, Data: reading}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("storage: serializando leitura: %w", err)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	path := fs.dayFilePath(now)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("storage: abrindo %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("storage: escrevendo em %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// Query retorna as leituras cujo timestamp está em [from, to], projetadas
+// para os campos pedidos (fields vazio retorna o registro completo),
+// limitadas a limit itens (0 ou negativo significa sem limite). deviceID
+// vazio retorna leituras de todos os dispositivos; caso contrário, só as
+// daquele device_id.
+func (fs *FileStore) Query(from, to time.Time, fields []string, limit int, deviceID string) ([]Record, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	var result []Record
+	for day := from.UTC().Truncate(24 * time.Hour); !day.After(to); day = day.AddDate(0, 0, 1) {
+		records, err := fs.readDayFile(day)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, rec := range records {
+			if rec.Timestamp.Before(from) || rec.Timestamp.After(to) {
+				continue
+			}
+			if deviceID != "" && rec.Data.DeviceID != deviceID {
+				continue
+			}
+			result = append(result, projectFields(rec, fields))
+			if limit > 0 && len(result) >= limit {
+				return result, nil
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// Stats calcula min/max/avg para cada campo numérico pedido, considerando
+// apenas leituras dentro dos últimos `window` (e, se deviceID não for
+// vazio, apenas daquele dispositivo).
+func (fs *FileStore) Stats(window time.Duration, fields []string, deviceID string) (map[string]FieldStats, error) {
+	to := time.Now().UTC()
+	from := to.Add(-window)
+
+	records, err := fs.Query(from, to, nil, 0, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 {
+		fields = []string{"temperatura", "umidade_ar", "luminosidade", "umidade_solo", "solo_bruto"}
+	}
+
+	stats := make(map[string]FieldStats, len(fields))
+	for _, field := range fields {
+		var (
+			sum   float64
+			count int
+			min   = math.Inf(1)
+			max   = math.Inf(-1)
+		)
+		for _, rec := range records {
+			value, ok := numericField(rec.Data, field)
+			if !ok {
+				continue
+			}
+			sum += value
+			count++
+			if value < min {
+				min = value
+			}
+			if value > max {
+				max = value
+			}
+		}
+		if count == 0 {
+			stats[field] = FieldStats{}
+			continue
+		}
+		stats[field] = FieldStats{Min: min, Max: max, Avg: sum / float64(count), Count: count}
+	}
+
+	return stats, nil
+}
+
+// Close encerra a rotina de retenção em background.
+func (fs *FileStore) Close() error {
+	close(fs.stopCh)
+	<-fs.doneCh
+	return nil
+}
+
+func (fs *FileStore) dayFilePath(t time.Time) string {
+	return filepath.Join(fs.dataDir, fmt.Sprintf("readings-%s.jsonl", t.Format(dayFileLayout)))
+}
+
+// readDayFile assume que fs.mu já está travado (RLock basta, já que só lê).
+func (fs *FileStore) readDayFile(day time.Time) ([]Record, error) {
+	path := fs.dayFilePath(day)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue // linha corrompida, ignora e segue
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("storage: lendo %s: %w", path, err)
+	}
+
+	return records, nil
+}
+
+func (fs *FileStore) retentionLoop() {
+	defer close(fs.doneCh)
+
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fs.stopCh:
+			return
+		case <-ticker.C:
+			fs.applyRetention()
+			fs.compactYesterday()
+		}
+	}
+}
+
+// compactYesterday compacta o arquivo do dia anterior, que não recebe
+// mais gravações (Append só escreve no arquivo do dia corrente). Rodar a
+// cada tick é seguro: compactFile é idempotente e, se o arquivo já não
+// tiver linhas corrompidas a remover, só reescreve o mesmo conteúdo.
+func (fs *FileStore) compactYesterday() {
+	yesterday := time.Now().UTC().AddDate(0, 0, -1)
+	fs.compactFile(yesterday)
+}
+
+// applyRetention remove arquivos de dia mais antigos que retentionDays.
+func (fs *FileStore) applyRetention() {
+	if fs.retentionDays <= 0 {
+		return
+	}
+
+	cutoff := time.Now().UTC().AddDate(0, 0, -fs.retentionDays)
+
+	entries, err := os.ReadDir(fs.dataDir)
+	if err != nil {
+		return
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for _, entry := range entries {
+		day, ok := parseDayFileName(entry.Name())
+		if !ok || !day.Before(cutoff) {
+			continue
+		}
+		os.Remove(filepath.Join(fs.dataDir, entry.Name()))
+	}
+}
+
+// compactFile reescreve o arquivo do dia mantendo só os registros válidos,
+// usando o padrão write-temp+rename para que uma falha no meio da escrita
+// nunca deixe o arquivo original corrompido.
+func (fs *FileStore) compactFile(day time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	records, err := fs.readDayFile(day)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].Timestamp.Before(records[j].Timestamp) })
+
+	path := fs.dayFilePath(day)
+	tmpPath := path + ".tmp"
+
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("storage: criando arquivo temporário: %w", err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	for _, rec := range records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("storage: serializando durante compactação: %w", err)
+		}
+		if _, err := writer.Write(append(line, '\n')); err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("storage: escrevendo arquivo temporário: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("storage: flush do arquivo temporário: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("storage: fechando arquivo temporário: %w", err)
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+func parseDayFileName(name string) (time.Time, bool) {
+	const prefix, suffix = "readings-", ".jsonl"
+	if len(name) != len(prefix)+len(dayFileLayout)+len(suffix) {
+		return time.Time{}, false
+	}
+	day := name[len(prefix) : len(name)-len(suffix)]
+	t, err := time.Parse(dayFileLayout, day)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func projectFields(rec Record, fields []string) Record {
+	if len(fields) == 0 {
+		return rec
+	}
+
+	projected := model.SensorData{Tipo: rec.Data.Tipo, DataHora: rec.Data.DataHora}
+	for _, field := range fields {
+		switch field {
+		case "temperatura":
+			projected.Temperatura = rec.Data.Temperatura
+		case "umidade_ar":
+			projected.UmidadeAr = rec.Data.UmidadeAr
+		case "luminosidade":
+			projected.Luminosidade = rec.Data.Luminosidade
+		case "umidade_solo":
+			projected.UmidadeSolo = rec.Data.UmidadeSolo
+		case "solo_bruto":
+			projected.SoloBruto = rec.Data.SoloBruto
+		case "status_bomba":
+			projected.StatusBomba = rec.Data.StatusBomba
+		case "status_luz":
+			projected.StatusLuz = rec.Data.StatusLuz
+		}
+	}
+
+	return Record{Timestamp: rec.Timestamp, Data: projected}
+}
+
+func numericField(data model.SensorData, field string) (float64, bool) {
+	switch field {
+	case "temperatura":
+		if data.Temperatura == nil {
+			return 0, false
+		}
+		return *data.Temperatura, true
+	case "umidade_ar":
+		if data.UmidadeAr == nil {
+			return 0, false
+		}
+		return *data.UmidadeAr, true
+	case "luminosidade":
+		if data.Luminosidade == nil {
+			return 0, false
+		}
+		return float64(*data.Luminosidade), true
+	case "umidade_solo":
+		if data.UmidadeSolo == nil {
+			return 0, false
+		}
+		return float64(*data.UmidadeSolo), true
+	case "solo_bruto":
+		if data.SoloBruto == nil {
+			return 0, false
+		}
+		return float64(*data.SoloBruto), true
+	default:
+		return 0, false
+	}
+}
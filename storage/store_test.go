@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"miniestufa-backend/model"
+)
+
+// TestFileStoreConcurrentAppendQueryCompact exercita Append (escrita),
+// Query (leitura) e compactFile (escrita, via write-temp+rename)
+// concorrentemente. Pensado para rodar com `go test -race`: antes da
+// conversão de fs.mu para RWMutex e da ligação de compactFile ao
+// retentionLoop, essa combinação já teria exposto as duas corridas
+// corrigidas em d0058b5 e 1232362.
+func TestFileStoreConcurrentAppendQueryCompact(t *testing.T) {
+	fs, err := NewFileStore(t.TempDir(), 30)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	defer fs.Close()
+
+	now := time.Now().UTC()
+	from, to := now.Add(-time.Hour), now.Add(time.Hour)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			temp := float64(i)
+			if err := fs.Append(model.SensorData{Tipo: "leitura", Temperatura: &temp}); err != nil {
+				t.Errorf("Append: %v", err)
+			}
+		}(i)
+	}
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := fs.Query(from, to, nil, 0, ""); err != nil {
+				t.Errorf("Query: %v", err)
+			}
+		}()
+	}
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fs.compactFile(now); err != nil {
+				t.Errorf("compactFile: %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	records, err := fs.Query(from, to, nil, 0, "")
+	if err != nil {
+		t.Fatalf("Query final: %v", err)
+	}
+	if len(records) != 20 {
+		t.Fatalf("esperava 20 registros após a compactação, veio %d", len(records))
+	}
+}
+
+// TestFileStoreQueryFiltersByDevice garante que o filtro por device_id
+// adicionado a Query não mistura leituras de estufas diferentes.
+func TestFileStoreQueryFiltersByDevice(t *testing.T) {
+	fs, err := NewFileStore(t.TempDir(), 30)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	defer fs.Close()
+
+	if err := fs.Append(model.SensorData{DeviceID: "estufa-01", Tipo: "leitura"}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := fs.Append(model.SensorData{DeviceID: "estufa-02", Tipo: "leitura"}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	now := time.Now().UTC()
+	records, err := fs.Query(now.Add(-time.Hour), now.Add(time.Hour), nil, 0, "estufa-01")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(records) != 1 || records[0].Data.DeviceID != "estufa-01" {
+		t.Fatalf("esperava só a leitura de estufa-01, veio %+v", records)
+	}
+}